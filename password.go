@@ -0,0 +1,187 @@
+// Copyright 2012 Dmitry Chestnykh   (Go implementation)
+// Copyright 2009 Colin Percival     (original C implementation)
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scrypt
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Params holds the scrypt cost parameters and salt/key sizes used by
+// GenerateFromPassword. N must be a power of two greater than 1; see Key
+// for the meaning of N, R and P.
+type Params struct {
+	N       int
+	R       int
+	P       int
+	SaltLen int
+	KeyLen  int
+}
+
+// DefaultParams are reasonable parameters for interactive logins as of
+// 2014: N=16384, r=8, p=1, a 16-byte salt and a 32-byte derived key. As
+// hardware gets faster, increase N (keeping it a power of two) or use
+// Recommend to choose parameters that fit a time and memory budget.
+var DefaultParams = Params{
+	N:       16384,
+	R:       8,
+	P:       1,
+	SaltLen: 16,
+	KeyLen:  32,
+}
+
+// ErrMismatchedHashAndPassword is returned by CompareHashAndPassword when a
+// password does not match the given hash.
+var ErrMismatchedHashAndPassword = errors.New("scrypt: hashedPassword is not the hash of the given password")
+
+// errInvalidHash is returned when a hash string cannot be parsed.
+var errInvalidHash = errors.New("scrypt: hash is not a valid scrypt hash")
+
+// Hash format: $scrypt$ln=<log2N>,r=<r>,p=<p>$<salt base64>$<key base64>.
+//
+// This is a custom encoding, not one of the "$7$" (Colin Percival's
+// scryptenc) or "$s2$" scrypt crypt(3) variants; hashes produced by
+// GenerateFromPassword are only interoperable with CompareHashAndPassword
+// and Cost in this package, not with other scrypt MCF tooling. It follows
+// those formats' spirit of a single self-describing field-separated
+// string, chosen here for a simpler parser and a base64 alphabet matching
+// the rest of the Go standard library, at the cost of that
+// interoperability. Implement the real "$7$"/"$s2$" wire format instead if
+// interop with other scrypt password hashing tools is required.
+const hashPrefix = "$scrypt$"
+
+// GenerateFromPassword derives a key from password using the scrypt cost
+// parameters in params, and returns it encoded together with a random salt
+// and those parameters as a single string suitable for storage. The
+// returned string can later be checked against a candidate password with
+// CompareHashAndPassword, so callers do not need to keep track of N, r, p
+// or the salt themselves.
+//
+// The encoding is this package's own (see hashPrefix) and is not
+// interoperable with other implementations of scrypt-based MCF password
+// hashes.
+func GenerateFromPassword(password []byte, params Params) (string, error) {
+	if params.N <= 1 || params.N&(params.N-1) != 0 {
+		return "", errors.New("scrypt: N must be > 1 and a power of 2")
+	}
+	logN := 0
+	for n := params.N; n > 1; n >>= 1 {
+		logN++
+	}
+
+	salt := make([]byte, params.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key, err := Key(password, salt, params.N, params.R, params.P, params.KeyLen)
+	if err != nil {
+		return "", err
+	}
+
+	return encodeHash(logN, params.R, params.P, salt, key), nil
+}
+
+// CompareHashAndPassword compares a scrypt hashed password, as produced by
+// GenerateFromPassword, with a candidate password. It returns nil on a
+// match, or an error if they do not match or hash is malformed. The
+// comparison of the derived keys is done in constant time.
+func CompareHashAndPassword(hash, password []byte) error {
+	logN, r, p, salt, key, err := decodeHash(string(hash))
+	if err != nil {
+		return err
+	}
+
+	gotKey, err := Key(password, salt, 1<<uint(logN), r, p, len(key))
+	if err != nil {
+		return err
+	}
+
+	if subtle.ConstantTimeCompare(gotKey, key) != 1 {
+		return ErrMismatchedHashAndPassword
+	}
+	return nil
+}
+
+// Cost returns the scrypt parameters that were used to produce hash, so
+// that callers can compare them against their current policy and, if hash
+// was generated under weaker parameters, rehash the password with
+// GenerateFromPassword on the next successful login.
+func Cost(hash string) (Params, error) {
+	logN, r, p, salt, key, err := decodeHash(hash)
+	if err != nil {
+		return Params{}, err
+	}
+	return Params{
+		N:       1 << uint(logN),
+		R:       r,
+		P:       p,
+		SaltLen: len(salt),
+		KeyLen:  len(key),
+	}, nil
+}
+
+func encodeHash(logN, r, p int, salt, key []byte) string {
+	return fmt.Sprintf("%sln=%d,r=%d,p=%d$%s$%s",
+		hashPrefix, logN, r, p,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key))
+}
+
+func decodeHash(hash string) (logN, r, p int, salt, key []byte, err error) {
+	if !strings.HasPrefix(hash, hashPrefix) {
+		return 0, 0, 0, nil, nil, errInvalidHash
+	}
+	fields := strings.Split(strings.TrimPrefix(hash, hashPrefix), "$")
+	if len(fields) != 3 {
+		return 0, 0, 0, nil, nil, errInvalidHash
+	}
+
+	params := strings.Split(fields[0], ",")
+	if len(params) != 3 {
+		return 0, 0, 0, nil, nil, errInvalidHash
+	}
+	logN, err = parseParam(params[0], "ln=")
+	if err != nil {
+		return 0, 0, 0, nil, nil, err
+	}
+	r, err = parseParam(params[1], "r=")
+	if err != nil {
+		return 0, 0, 0, nil, nil, err
+	}
+	p, err = parseParam(params[2], "p=")
+	if err != nil {
+		return 0, 0, 0, nil, nil, err
+	}
+
+	salt, err = base64.RawStdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return 0, 0, 0, nil, nil, errInvalidHash
+	}
+	key, err = base64.RawStdEncoding.DecodeString(fields[2])
+	if err != nil {
+		return 0, 0, 0, nil, nil, errInvalidHash
+	}
+
+	return logN, r, p, salt, key, nil
+}
+
+func parseParam(field, prefix string) (int, error) {
+	if !strings.HasPrefix(field, prefix) {
+		return 0, errInvalidHash
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(field, prefix))
+	if err != nil {
+		return 0, errInvalidHash
+	}
+	return n, nil
+}
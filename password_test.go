@@ -0,0 +1,48 @@
+// Copyright 2012 Dmitry Chestnykh   (Go implementation)
+// Copyright 2009 Colin Percival     (original C implementation)
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scrypt
+
+import "testing"
+
+func TestGenerateAndCompare(t *testing.T) {
+	password := []byte("correct horse battery staple")
+
+	hash, err := GenerateFromPassword(password, Params{N: 16, R: 4, P: 1, SaltLen: 16, KeyLen: 32})
+	if err != nil {
+		t.Fatalf("GenerateFromPassword: %v", err)
+	}
+
+	if err := CompareHashAndPassword([]byte(hash), password); err != nil {
+		t.Errorf("CompareHashAndPassword failed for correct password: %v", err)
+	}
+
+	if err := CompareHashAndPassword([]byte(hash), []byte("wrong password")); err != ErrMismatchedHashAndPassword {
+		t.Errorf("CompareHashAndPassword = %v, want ErrMismatchedHashAndPassword", err)
+	}
+}
+
+func TestCost(t *testing.T) {
+	params := Params{N: 32, R: 4, P: 2, SaltLen: 16, KeyLen: 32}
+	hash, err := GenerateFromPassword([]byte("password"), params)
+	if err != nil {
+		t.Fatalf("GenerateFromPassword: %v", err)
+	}
+
+	got, err := Cost(hash)
+	if err != nil {
+		t.Fatalf("Cost: %v", err)
+	}
+	if got.N != params.N || got.R != params.R || got.P != params.P || got.KeyLen != params.KeyLen {
+		t.Errorf("Cost = %+v, want %+v", got, params)
+	}
+}
+
+func TestCompareHashAndPasswordInvalidHash(t *testing.T) {
+	if err := CompareHashAndPassword([]byte("not a hash"), []byte("password")); err == nil {
+		t.Error("expected error for malformed hash")
+	}
+}
@@ -13,6 +13,9 @@ import (
 	"crypto/sha256"
 	"encoding/binary"
 	"errors"
+	"hash"
+	"runtime"
+	"sync"
 
 	"code.google.com/p/go.crypto/pbkdf2"
 )
@@ -239,20 +242,92 @@ func smix(b []byte, r, N int, v, xy []byte) {
 // r=8, p=1. They should be increased as memory latency and CPU parallelism
 // increases. Remember to get a good random salt.
 func Key(password, salt []byte, N, r, p, keyLen int) ([]byte, error) {
-	if N <= 1 || N&(N-1) != 0 {
-		return nil, errors.New("scrypt: N must be > 1 and a power of 2")
-	}
-	if uint64(r)*uint64(p) >= 1<<30 || r > maxInt/128/p || r > maxInt/256 || N > maxInt/128/r {
-		return nil, errors.New("scrypt: parameters are too large")
+	return KeyWithHash(password, salt, N, r, p, keyLen, sha256.New)
+}
+
+// KeyWithHash is equivalent to Key, but uses h instead of SHA-256 as the
+// hash function underlying the two PBKDF2 passes that bracket smix. h is
+// typically one of sha256.New, sha512.New, sha512.New384 or
+// sha256.New224, to match PBKDF2's own generality and to let FIPS-mode
+// deployments that mandate a specific SHA-2 variant satisfy that
+// requirement.
+//
+// Changing h changes the derived key: KeyWithHash(..., sha512.New) does
+// not produce the same output as Key with the same password, salt and
+// cost parameters, and using a hash other than SHA-256 is not a security
+// upgrade over Key, only a compatibility or policy choice.
+func KeyWithHash(password, salt []byte, N, r, p, keyLen int, h func() hash.Hash) ([]byte, error) {
+	if err := checkParams(N, r, p); err != nil {
+		return nil, err
 	}
 
 	xy := make([]byte, 256*r)
 	v := make([]byte, 128*r*N)
-	b := pbkdf2.Key(password, salt, 1, p*128*r, sha256.New)
+	b := pbkdf2.Key(password, salt, 1, p*128*r, h)
 
 	for i := 0; i < p; i++ {
 		smix(b[i*128*r:], r, N, v, xy)
 	}
 
+	return pbkdf2.Key(password, b, 1, keyLen, h), nil
+}
+
+// KeyParallel is equivalent to Key, but runs the p independent smix calls on
+// up to runtime.GOMAXPROCS(0) goroutines instead of a single one.
+//
+// Since each smix call works on its own 128*r-byte block and each worker
+// allocates its own N*128*r-byte scratch space (Key reuses a single one for
+// all p calls), splitting the for i := 0; i < p; i++ loop
+// across workers is a large win whenever p > 1 and multiple cores are
+// available; it does not change the derived key, so KeyParallel(password,
+// salt, N, r, p, keyLen) always returns the same result as Key with the same
+// arguments.
+func KeyParallel(password, salt []byte, N, r, p, keyLen int) ([]byte, error) {
+	if err := checkParams(N, r, p); err != nil {
+		return nil, err
+	}
+
+	b := pbkdf2.Key(password, salt, 1, p*128*r, sha256.New)
+
+	workers := runtime.GOMAXPROCS(0)
+	if workers > p {
+		workers = p
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	var wg sync.WaitGroup
+	work := make(chan int)
+
+	for n := 0; n < workers; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			xy := make([]byte, 256*r)
+			v := make([]byte, 128*r*N)
+			for i := range work {
+				smix(b[i*128*r:], r, N, v, xy)
+			}
+		}()
+	}
+	for i := 0; i < p; i++ {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
 	return pbkdf2.Key(password, b, 1, keyLen, sha256.New), nil
 }
+
+// checkParams validates the scrypt cost parameters shared by Key and
+// KeyParallel.
+func checkParams(N, r, p int) error {
+	if N <= 1 || N&(N-1) != 0 {
+		return errors.New("scrypt: N must be > 1 and a power of 2")
+	}
+	if uint64(r)*uint64(p) >= 1<<30 || r > maxInt/128/p || r > maxInt/256 || N > maxInt/128/r {
+		return errors.New("scrypt: parameters are too large")
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2012 Dmitry Chestnykh   (Go implementation)
+// Copyright 2009 Colin Percival     (original C implementation)
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scrypt
+
+import (
+	"crypto/sha512"
+	"testing"
+)
+
+func benchmarkKey(b *testing.B, p int) {
+	password := []byte("mypassword")
+	salt := []byte("saltsaltsaltsalt")
+	for i := 0; i < b.N; i++ {
+		if _, err := Key(password, salt, 16384, 8, p, 32); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkKeyParallel(b *testing.B, p int) {
+	password := []byte("mypassword")
+	salt := []byte("saltsaltsaltsalt")
+	for i := 0; i < b.N; i++ {
+		if _, err := KeyParallel(password, salt, 16384, 8, p, 32); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkKeyP1(b *testing.B) { benchmarkKey(b, 1) }
+func BenchmarkKeyP2(b *testing.B) { benchmarkKey(b, 2) }
+func BenchmarkKeyP4(b *testing.B) { benchmarkKey(b, 4) }
+func BenchmarkKeyP8(b *testing.B) { benchmarkKey(b, 8) }
+
+func BenchmarkKeyParallelP1(b *testing.B) { benchmarkKeyParallel(b, 1) }
+func BenchmarkKeyParallelP2(b *testing.B) { benchmarkKeyParallel(b, 2) }
+func BenchmarkKeyParallelP4(b *testing.B) { benchmarkKeyParallel(b, 4) }
+func BenchmarkKeyParallelP8(b *testing.B) { benchmarkKeyParallel(b, 8) }
+
+func TestKeyWithHash(t *testing.T) {
+	password := []byte("mypassword")
+	salt := []byte("saltsaltsaltsalt")
+
+	sha256Key, err := Key(password, salt, 16, 4, 1, 32)
+	if err != nil {
+		t.Fatalf("Key: %v", err)
+	}
+	sameKey, err := KeyWithHash(password, salt, 16, 4, 1, 32, sha512.New)
+	if err != nil {
+		t.Fatalf("KeyWithHash(sha512.New): %v", err)
+	}
+	if string(sameKey) == string(sha256Key) {
+		t.Error("KeyWithHash(sha512.New) produced the same output as Key, expected them to differ")
+	}
+
+	again, err := KeyWithHash(password, salt, 16, 4, 1, 32, sha512.New)
+	if err != nil {
+		t.Fatalf("KeyWithHash(sha512.New): %v", err)
+	}
+	if string(again) != string(sameKey) {
+		t.Error("KeyWithHash(sha512.New) is not deterministic")
+	}
+}
+
+func TestKeyParallelMatchesKey(t *testing.T) {
+	password := []byte("mypassword")
+	salt := []byte("saltsaltsaltsalt")
+
+	for _, p := range []int{1, 2, 3, 5} {
+		want, err := Key(password, salt, 16, 4, p, 32)
+		if err != nil {
+			t.Fatalf("Key(p=%d): %v", p, err)
+		}
+		got, err := KeyParallel(password, salt, 16, 4, p, 32)
+		if err != nil {
+			t.Fatalf("KeyParallel(p=%d): %v", p, err)
+		}
+		if string(got) != string(want) {
+			t.Errorf("KeyParallel(p=%d) = %x, want %x", p, got, want)
+		}
+	}
+}
@@ -0,0 +1,348 @@
+// Copyright 2014 Dmitry Chestnykh.
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package scryptfile implements the scrypt encrypted file format designed
+// by Colin Percival for the Tarsnap "scrypt" reference tool. It lets Go
+// programs produce and consume files that are interoperable with that
+// tool without shelling out to it.
+//
+// WARNING: the io.Reader returned by Decrypt / DecryptWithMaxMem streams
+// plaintext to the caller before the file's trailing HMAC-SHA-256 tag has
+// been checked. A wrong password is rejected by Decrypt itself, through the
+// header's HMAC, but tampering with or truncation of the ciphertext is only
+// reported by the final Read, which returns ErrBadPassphraseOrCorrupt (or
+// ErrInvalidHeader if fewer bytes than a tag remain) in place of io.EOF.
+// Code that uses io.Copy, or otherwise acts on
+// bytes as they arrive, can act on unauthenticated data. Callers that need
+// authenticate-then-release semantics must buffer the entire output (e.g.
+// via ioutil.ReadAll) and check the returned error before using any of it.
+package scryptfile
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"io"
+
+	"github.com/dchest/scrypt"
+)
+
+const (
+	magic     = "scrypt"
+	version   = 0
+	headerLen = 96 // magic(6) + version(1) + logN(1) + r(4) + p(4) + salt(32) + checksum(16) + hmac(32)
+	saltLen   = 32
+	macLen    = 32
+	dkLen     = 64 // 32-byte AES-256 key + 32-byte HMAC-SHA-256 key
+)
+
+// maxInt is the largest value that fits in an int on this platform, used
+// to bound-check header fields before converting them from uint64/uint32.
+const maxInt = int(^uint(0) >> 1)
+
+// mulOverflows reports whether a*b overflows uint64.
+func mulOverflows(a, b uint64) bool {
+	if a == 0 || b == 0 {
+		return false
+	}
+	return a > ^uint64(0)/b
+}
+
+// DefaultMaxMem is the memory ceiling used by Decrypt. Files whose embedded
+// N and r would require more than this much scratch space are rejected
+// before any of it is allocated.
+const DefaultMaxMem = 1 << 30 // 1 GiB
+
+var (
+	// ErrInvalidHeader is returned when the input is not a scrypt encrypted
+	// file, or uses a version this package does not understand.
+	ErrInvalidHeader = errors.New("scryptfile: invalid header")
+
+	// ErrTooMuchMemory is returned by Decrypt when the file's N and r would
+	// require more memory than the caller's maxMem allows.
+	ErrTooMuchMemory = errors.New("scryptfile: parameters require too much memory")
+
+	// ErrBadPassphraseOrCorrupt is returned when the password is wrong or
+	// the file's header or ciphertext has been tampered with.
+	ErrBadPassphraseOrCorrupt = errors.New("scryptfile: incorrect password or file is corrupt")
+)
+
+// Params holds the scrypt cost parameters used to derive the encryption
+// and authentication keys for a file. N must be a power of two greater
+// than 1; see scrypt.Key for the meaning of N, R and P.
+type Params struct {
+	N int
+	R int
+	P int
+}
+
+// Encrypt writes a scrypt file header derived from password and params to
+// w, and returns an io.WriteCloser that encrypts everything written to it
+// with AES-256-CTR and authenticates header and ciphertext with
+// HMAC-SHA-256, appending the resulting tag when Close is called.
+func Encrypt(w io.Writer, password []byte, params Params) (io.WriteCloser, error) {
+	logN, err := log2(params.N)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, headerLen)
+	copy(header, magic)
+	header[6] = version
+	header[7] = byte(logN)
+	binary.BigEndian.PutUint32(header[8:12], uint32(params.R))
+	binary.BigEndian.PutUint32(header[12:16], uint32(params.P))
+	copy(header[16:16+saltLen], salt)
+
+	checksum := sha256.Sum256(header[:48])
+	copy(header[48:64], checksum[:16])
+
+	dk, err := scrypt.Key(password, salt, params.N, params.R, params.P, dkLen)
+	if err != nil {
+		return nil, err
+	}
+	aesKey, hmacKey := dk[:32], dk[32:64]
+
+	headerMAC := hmac.New(sha256.New, hmacKey)
+	headerMAC.Write(header[:64])
+	copy(header[64:96], headerMAC.Sum(nil))
+
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(aesKey)
+	if err != nil {
+		return nil, err
+	}
+	stream := cipher.NewCTR(block, make([]byte, aes.BlockSize))
+
+	mac := hmac.New(sha256.New, hmacKey)
+	mac.Write(header)
+
+	return &encryptWriter{w: w, stream: stream, mac: mac}, nil
+}
+
+type encryptWriter struct {
+	w      io.Writer
+	stream cipher.Stream
+	mac    hash.Hash
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	ciphertext := make([]byte, len(p))
+	e.stream.XORKeyStream(ciphertext, p)
+	if _, err := e.w.Write(ciphertext); err != nil {
+		return 0, err
+	}
+	e.mac.Write(ciphertext)
+	return len(p), nil
+}
+
+func (e *encryptWriter) Close() error {
+	_, err := e.w.Write(e.mac.Sum(nil))
+	return err
+}
+
+// Decrypt is equivalent to DecryptWithMaxMem(r, password, DefaultMaxMem).
+//
+// See the package doc for an important warning: the returned io.Reader
+// releases plaintext before the file's trailing HMAC tag is verified.
+func Decrypt(r io.Reader, password []byte) (io.Reader, error) {
+	return DecryptWithMaxMem(r, password, DefaultMaxMem)
+}
+
+// DecryptWithMaxMem reads a scrypt file header from r, rejecting it with
+// ErrTooMuchMemory before deriving any keys if the embedded N and r would
+// require allocating more than maxMem bytes of scrypt scratch space. It
+// then derives the keys from password and checks the header's own
+// authentication tag, and returns an io.Reader that decrypts the remainder
+// of r.
+//
+// WARNING: that returned io.Reader releases each chunk of plaintext to
+// the caller as soon as it can prove the chunk isn't the file's trailing
+// HMAC-SHA-256 tag, i.e. before the tag itself has been checked. Only the
+// final Read call verifies it and reports ErrBadPassphraseOrCorrupt on
+// mismatch; a caller that streams the output elsewhere before then (e.g.
+// with io.Copy) can act on data that later turns out to be unauthenticated.
+// Buffer the full output and check the terminal error before trusting any
+// of it if that matters for your use case.
+func DecryptWithMaxMem(r io.Reader, password []byte, maxMem uint64) (io.Reader, error) {
+	header := make([]byte, headerLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, ErrInvalidHeader
+	}
+	if string(header[:6]) != magic || header[6] != version {
+		return nil, ErrInvalidHeader
+	}
+
+	logN := int(header[7])
+	if logN <= 0 || logN >= 63 {
+		return nil, ErrInvalidHeader
+	}
+	rParam64 := uint64(binary.BigEndian.Uint32(header[8:12]))
+	pParam64 := uint64(binary.BigEndian.Uint32(header[12:16]))
+	if rParam64 == 0 || pParam64 == 0 {
+		return nil, ErrInvalidHeader
+	}
+	salt := header[16 : 16+saltLen]
+
+	checksum := sha256.Sum256(header[:48])
+	if subtle.ConstantTimeCompare(checksum[:16], header[48:64]) != 1 {
+		return nil, ErrInvalidHeader
+	}
+
+	// r and N come straight from the (attacker-controlled) header, so
+	// 128*r*N is computed with explicit overflow checks rather than a bare
+	// uint64 multiplication: r can be as large as 2^32-1 and N as large as
+	// 2^62, and 128*r*N wraps well before it reaches a real memory size,
+	// which would otherwise let an oversized file slip under maxMem and
+	// defeat the whole point of rejecting it before allocating scratch
+	// space.
+	N64 := uint64(1) << uint(logN)
+	if N64 > uint64(maxInt) || rParam64 > uint64(maxInt) || pParam64 > uint64(maxInt) {
+		return nil, ErrTooMuchMemory
+	}
+	if mulOverflows(rParam64, N64) {
+		return nil, ErrTooMuchMemory
+	}
+	rN := rParam64 * N64
+	if mulOverflows(128, rN) {
+		return nil, ErrTooMuchMemory
+	}
+	if mem := 128 * rN; mem > maxMem {
+		return nil, ErrTooMuchMemory
+	}
+
+	N, rParam, pParam := int(N64), int(rParam64), int(pParam64)
+
+	dk, err := scrypt.Key(password, salt, N, rParam, pParam, dkLen)
+	if err != nil {
+		return nil, err
+	}
+	aesKey, hmacKey := dk[:32], dk[32:64]
+
+	headerMAC := hmac.New(sha256.New, hmacKey)
+	headerMAC.Write(header[:64])
+	if !hmac.Equal(headerMAC.Sum(nil), header[64:96]) {
+		return nil, ErrBadPassphraseOrCorrupt
+	}
+
+	block, err := aes.NewCipher(aesKey)
+	if err != nil {
+		return nil, err
+	}
+	stream := cipher.NewCTR(block, make([]byte, aes.BlockSize))
+
+	mac := hmac.New(sha256.New, hmacKey)
+	mac.Write(header)
+
+	return &decryptReader{r: r, stream: stream, mac: mac}, nil
+}
+
+// decryptReader decrypts a scrypt file body while withholding the last
+// macLen bytes of ciphertext it has read (the file's trailing HMAC tag)
+// until it can verify them against the running HMAC over the header and
+// ciphertext. Decrypted bytes that are ready to be returned, including the
+// final chunk once the tag has been verified, sit in out until consumed by
+// Read.
+//
+// Every chunk released before the final one is therefore unauthenticated
+// at the time Read returns it: it cannot yet have been checked against a
+// tag that hasn't been read off the wire. See the package doc.
+type decryptReader struct {
+	r      io.Reader
+	stream cipher.Stream
+	mac    hash.Hash
+	pend   bytes.Buffer // ciphertext withheld because it might be the trailing tag
+	out    bytes.Buffer // decrypted plaintext ready to be returned
+	err    error        // sticky terminal error, including io.EOF
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for d.out.Len() == 0 && d.err == nil {
+		d.fill()
+	}
+	if d.out.Len() > 0 {
+		return d.out.Read(p)
+	}
+	return 0, d.err
+}
+
+// fill reads one chunk from the underlying reader, releasing any withheld
+// ciphertext that is now known not to be part of the trailing tag into
+// plaintext in out, or, once the underlying reader is exhausted, verifying
+// the tag and releasing the final plaintext.
+func (d *decryptReader) fill() {
+	buf := make([]byte, 32*1024)
+	n, err := d.r.Read(buf)
+	if n > 0 {
+		d.pend.Write(buf[:n])
+	}
+	if err == nil {
+		if d.pend.Len() > macLen {
+			ciphertext := d.pend.Next(d.pend.Len() - macLen)
+			d.release(ciphertext)
+		}
+		return
+	}
+	if err != io.EOF {
+		d.err = err
+		return
+	}
+
+	// Underlying reader is exhausted: whatever remains beyond macLen bytes
+	// is the final ciphertext, and the last macLen bytes are the tag.
+	if d.pend.Len() < macLen {
+		d.err = ErrInvalidHeader
+		return
+	}
+	tag := make([]byte, macLen)
+	copy(tag, d.pend.Bytes()[d.pend.Len()-macLen:])
+	ciphertext := d.pend.Next(d.pend.Len() - macLen)
+	d.mac.Write(ciphertext)
+
+	if !hmac.Equal(d.mac.Sum(nil), tag) {
+		d.err = ErrBadPassphraseOrCorrupt
+		return
+	}
+
+	plaintext := make([]byte, len(ciphertext))
+	d.stream.XORKeyStream(plaintext, ciphertext)
+	d.out.Write(plaintext)
+	d.err = io.EOF
+}
+
+// release decrypts ciphertext known not to be part of the trailing tag and
+// appends the plaintext to out.
+func (d *decryptReader) release(ciphertext []byte) {
+	d.mac.Write(ciphertext)
+	plaintext := make([]byte, len(ciphertext))
+	d.stream.XORKeyStream(plaintext, ciphertext)
+	d.out.Write(plaintext)
+}
+
+func log2(n int) (int, error) {
+	if n <= 1 || n&(n-1) != 0 {
+		return 0, errors.New("scryptfile: N must be > 1 and a power of 2")
+	}
+	logN := 0
+	for v := n; v > 1; v >>= 1 {
+		logN++
+	}
+	return logN, nil
+}
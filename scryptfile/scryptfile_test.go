@@ -0,0 +1,97 @@
+// Copyright 2014 Dmitry Chestnykh.
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scryptfile
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"io/ioutil"
+	"testing"
+)
+
+func TestEncryptDecryptRoundTrip(t *testing.T) {
+	password := []byte("correct horse battery staple")
+	plaintext := []byte("the quick brown fox jumps over the lazy dog, repeated a few times\n" +
+		"the quick brown fox jumps over the lazy dog, repeated a few times\n")
+
+	var buf bytes.Buffer
+	w, err := Encrypt(&buf, password, Params{N: 16, R: 4, P: 1})
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	r, err := Decrypt(&buf, password)
+	if err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Errorf("got %q, want %q", got, plaintext)
+	}
+}
+
+func TestDecryptWrongPassword(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := Encrypt(&buf, []byte("password"), Params{N: 16, R: 4, P: 1})
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	w.Write([]byte("secret"))
+	w.Close()
+
+	if _, err := Decrypt(&buf, []byte("wrong password")); err != ErrBadPassphraseOrCorrupt {
+		t.Errorf("Decrypt = %v, want ErrBadPassphraseOrCorrupt", err)
+	}
+}
+
+func TestDecryptRejectsExcessiveMemory(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := Encrypt(&buf, []byte("password"), Params{N: 1024, R: 8, P: 1})
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	w.Write([]byte("secret"))
+	w.Close()
+
+	_, err = DecryptWithMaxMem(&buf, []byte("password"), 1024) // 1 KiB cap, far too small
+	if err != ErrTooMuchMemory {
+		t.Errorf("DecryptWithMaxMem = %v, want ErrTooMuchMemory", err)
+	}
+}
+
+// TestDecryptRejectsOverflowingMemory covers a header with an r large
+// enough that 128*r*N wraps uint64 and comes out below maxMem; this used
+// to let the ErrTooMuchMemory early-reject be bypassed by a forged
+// header with an implausible r.
+func TestDecryptRejectsOverflowingMemory(t *testing.T) {
+	header := make([]byte, headerLen)
+	copy(header, magic)
+	header[6] = version
+	header[7] = 61 // logN: N = 1<<61
+	binary.BigEndian.PutUint32(header[8:12], 0xffffffff)
+	binary.BigEndian.PutUint32(header[12:16], 1)
+	// salt left zeroed; only the checksum needs to be valid to reach the
+	// memory check.
+	checksum := sha256.Sum256(header[:48])
+	copy(header[48:64], checksum[:16])
+	// header[64:96] (the header HMAC) is never checked before the memory
+	// cap rejects this header, so it is left zeroed.
+
+	_, err := DecryptWithMaxMem(bytes.NewReader(header), []byte("password"), DefaultMaxMem)
+	if err != ErrTooMuchMemory {
+		t.Errorf("DecryptWithMaxMem with overflowing r*N = %v, want ErrTooMuchMemory", err)
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2014 Dmitry Chestnykh.
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scrypt
+
+import (
+	"errors"
+	"time"
+)
+
+// InteractiveTime and FileTime are the default time budgets used by
+// Recommend for interactive and non-interactive (e.g. file encryption)
+// use, mirroring the targets scryptenc uses: roughly 100ms for a login
+// prompt and 5s for encrypting a file at rest.
+const (
+	InteractiveTime = 100 * time.Millisecond
+	FileTime        = 5 * time.Second
+)
+
+// DefaultMaxMemFraction is the fraction of total system RAM Recommend
+// targets when the caller passes maxMem == 0 and the amount of RAM can be
+// determined for the host platform: total/DefaultMaxMemFraction.
+const DefaultMaxMemFraction = 4
+
+// DefaultMaxMem is the memory ceiling Recommend falls back to when maxMem
+// is 0 and the amount of system RAM cannot be determined on this
+// platform: a fixed 64 MiB, well within what even small deployments can
+// spare for a single key derivation.
+const DefaultMaxMem = 64 * 1024 * 1024
+
+// defaultMaxMem returns DefaultMaxMemFraction of total system RAM when it
+// can be determined via systemMemory, or DefaultMaxMem otherwise.
+func defaultMaxMem() uint64 {
+	if total, ok := systemMemory(); ok && total > 0 {
+		return total / DefaultMaxMemFraction
+	}
+	return DefaultMaxMem
+}
+
+// tuneR and tuneP are the parameters used for the microbenchmark smix
+// call that estimates this host's salsa20/8 throughput.
+const (
+	tuneN = 128
+	tuneR = 8
+	tuneP = 1
+)
+
+// Recommend picks N, r and p for Key so that deriving a key costs no more
+// than maxTime and uses no more than maxMem bytes of memory, following the
+// approach of Colin Percival's scryptenc: it microbenchmarks a small smix
+// call to estimate this host's throughput, then grows N by powers of two
+// for as long as the memory and time budgets allow, and finally raises p
+// to spend any remaining time budget once N can no longer grow within
+// maxMem.
+//
+// If maxMem is 0, it defaults to DefaultMaxMemFraction of total system RAM
+// where that can be determined, or DefaultMaxMem otherwise. r is fixed at
+// 8, which Percival's analysis found near-optimal across a wide range of
+// hardware.
+//
+// interactive should be true for parameters used to check a password as
+// part of a login, and false for parameters used to protect data at rest;
+// it only affects the default maxTime when maxTime is 0 (InteractiveTime
+// or FileTime, respectively).
+func Recommend(maxMem uint64, maxTime time.Duration, interactive bool) (N, r, p int, err error) {
+	if maxMem == 0 {
+		maxMem = defaultMaxMem()
+	}
+	if maxTime == 0 {
+		if interactive {
+			maxTime = InteractiveTime
+		} else {
+			maxTime = FileTime
+		}
+	}
+
+	r = tuneR
+
+	nsPerOp, err := benchmarkSmix()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	// Largest power-of-two N such that one smix call (p=1) fits maxTime
+	// and N*128*r fits maxMem.
+	maxMemN := maxMem / uint64(128*r)
+	N = 1
+	for {
+		next := N * 2
+		if uint64(next) > maxMemN {
+			break
+		}
+		nextTime := time.Duration(nsPerOp * int64(next) / tuneN)
+		if nextTime > maxTime {
+			break
+		}
+		N = next
+	}
+	if N < tuneN {
+		return 0, 0, 0, errors.New("scrypt: maxMem or maxTime too small to derive any usable parameters")
+	}
+
+	// With N fixed, spend any remaining time budget by raising p, which
+	// scales cost linearly; Key reuses one N*128*r scratch buffer for all p
+	// smix calls, so each unit of p only adds 128*r bytes of PBKDF2 output.
+	timePerP := time.Duration(nsPerOp * int64(N) / tuneN)
+	if timePerP <= 0 {
+		p = 1
+	} else {
+		p = int(maxTime / timePerP)
+		if p < 1 {
+			p = 1
+		}
+	}
+
+	return N, r, p, nil
+}
+
+// minBenchmarkTime is the minimum wall-clock time benchmarkSmix runs for.
+// A single smix(N=128) call takes on the order of microseconds, well
+// within the noise floor of the scheduler and the timer's own resolution;
+// looping until this much time has elapsed and averaging, as scryptenc's
+// scryptenc_cpuperf does, keeps that jitter from skewing the N (and
+// therefore the security level) Recommend settles on.
+const minBenchmarkTime = 10 * time.Millisecond
+
+// benchmarkSmix repeatedly times smix(N=128, r=8) calls until at least
+// minBenchmarkTime has elapsed, and returns the average cost, in
+// nanoseconds, of a single call, to extrapolate from.
+func benchmarkSmix() (int64, error) {
+	b := make([]byte, 128*tuneR)
+	xy := make([]byte, 256*tuneR)
+	v := make([]byte, 128*tuneR*tuneN)
+
+	var n int64
+	start := time.Now()
+	var elapsed time.Duration
+	for elapsed = time.Since(start); elapsed < minBenchmarkTime; elapsed = time.Since(start) {
+		smix(b, tuneR, tuneN, v, xy)
+		n++
+	}
+
+	if n == 0 {
+		// minBenchmarkTime elapsed before the first call started; time it
+		// directly instead of dividing by zero.
+		start = time.Now()
+		smix(b, tuneR, tuneN, v, xy)
+		elapsed = time.Since(start)
+		n = 1
+	}
+
+	nsPerOp := int64(elapsed) / n
+	if nsPerOp <= 0 {
+		nsPerOp = 1
+	}
+	return nsPerOp, nil
+}
@@ -0,0 +1,20 @@
+// Copyright 2014 Dmitry Chestnykh.
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package scrypt
+
+import "syscall"
+
+// systemMemory returns the total physical RAM installed on this host, via
+// the sysinfo(2) syscall, and whether it could be determined.
+func systemMemory() (uint64, bool) {
+	var si syscall.Sysinfo_t
+	if err := syscall.Sysinfo(&si); err != nil {
+		return 0, false
+	}
+	return uint64(si.Totalram) * uint64(si.Unit), true
+}
@@ -0,0 +1,14 @@
+// Copyright 2014 Dmitry Chestnykh.
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !linux
+
+package scrypt
+
+// systemMemory reports that total system RAM cannot be determined on this
+// platform; Recommend falls back to DefaultMaxMem in that case.
+func systemMemory() (uint64, bool) {
+	return 0, false
+}
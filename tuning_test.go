@@ -0,0 +1,79 @@
+// Copyright 2014 Dmitry Chestnykh.
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scrypt
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecommend(t *testing.T) {
+	N, r, p, err := Recommend(16*1024*1024, 0, true)
+	if err != nil {
+		t.Fatalf("Recommend: %v", err)
+	}
+	if N <= 1 || N&(N-1) != 0 {
+		t.Errorf("N = %d, want a power of 2 greater than 1", N)
+	}
+	if r != 8 {
+		t.Errorf("r = %d, want 8", r)
+	}
+	if p < 1 {
+		t.Errorf("p = %d, want >= 1", p)
+	}
+
+	if _, err := Key([]byte("password"), []byte("saltsaltsaltsalt"), N, r, p, 32); err != nil {
+		t.Errorf("Key with recommended parameters failed: %v", err)
+	}
+}
+
+func TestRecommendDefaultMaxMem(t *testing.T) {
+	N, r, p, err := Recommend(0, 0, true)
+	if err != nil {
+		t.Fatalf("Recommend(0, 0, true): %v", err)
+	}
+	if N <= 1 || N&(N-1) != 0 || r != 8 || p < 1 {
+		t.Errorf("Recommend(0, 0, true) = %d, %d, %d, want a usable N/r/p triple", N, r, p)
+	}
+}
+
+func TestRecommendRejectsTinyBudget(t *testing.T) {
+	if _, _, _, err := Recommend(1, 1, true); err == nil {
+		t.Error("expected error for a budget too small to fit any N")
+	}
+}
+
+// TestRecommendSubTuneNMaxMem covers maxMem values that cap N below tuneN
+// (128), which used to make N/tuneN truncate to 0 and panic on the
+// subsequent division when computing p. Recommend must either return
+// usable parameters or the "too small" error, never panic.
+func TestRecommendSubTuneNMaxMem(t *testing.T) {
+	for _, maxMem := range []uint64{64 * 1024, 65536, 131072 - 1} {
+		N, r, p, err := Recommend(maxMem, 0, true)
+		if err != nil {
+			continue
+		}
+		if N < 2 || r < 1 || p < 1 {
+			t.Errorf("Recommend(%d, 0, true) = %d, %d, %d, want all >= their minimums", maxMem, N, r, p)
+		}
+	}
+}
+
+func TestBenchmarkSmixRunsForMinimumTime(t *testing.T) {
+	start := time.Now()
+	nsPerOp, err := benchmarkSmix()
+	elapsed := time.Since(start)
+
+	if err != nil {
+		t.Fatalf("benchmarkSmix: %v", err)
+	}
+	if nsPerOp <= 0 {
+		t.Errorf("nsPerOp = %d, want > 0", nsPerOp)
+	}
+	if elapsed < minBenchmarkTime {
+		t.Errorf("benchmarkSmix returned after %v, want >= %v", elapsed, minBenchmarkTime)
+	}
+}